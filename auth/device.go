@@ -0,0 +1,202 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// Package auth implements the OAuth 2.0 device authorization grant (RFC 8628)
+// used by garm-cli to log into a garm server interactively, without ever asking
+// the user to type a password into a terminal.
+package auth
+
+import (
+	"sync"
+	"time"
+
+	runnerErrors "garm/errors"
+	"garm/util"
+)
+
+const (
+	// DefaultPollInterval is the interval, in seconds, a client should wait between
+	// two consecutive polls of the token endpoint, unless the server requests otherwise.
+	DefaultPollInterval = 5
+	// DeviceCodeExpiry is how long a device/user code pair remains valid.
+	DeviceCodeExpiry = 15 * time.Minute
+	// SlowDownIncrement is added to the poll interval every time the server replies
+	// with "slow_down", as mandated by RFC 8628.
+	SlowDownIncrement = 5 * time.Second
+)
+
+// Error codes returned in the "error" field of a token response, as defined by RFC 8628.
+const (
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrExpiredToken         = "expired_token"
+	ErrAccessDenied         = "access_denied"
+)
+
+// DeviceCodeResponse is returned by the /device/code endpoint.
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// TokenRequest is the body posted to /token while polling.
+type TokenRequest struct {
+	DeviceCode string `json:"device_code"`
+}
+
+// TokenResponse is returned by /token, either with a populated Error field while the
+// user has not yet approved the request, or with the issued tokens once they have.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// deviceAuthorization holds the server side bookkeeping for a single device code.
+type deviceAuthorization struct {
+	userCode  string
+	expiresAt time.Time
+	approved  bool
+	denied    bool
+	// lastPoll is used to enforce the minimal polling interval; a client polling
+	// too fast gets bumped into slow_down.
+	lastPoll time.Time
+	interval time.Duration
+}
+
+// Store persists in-flight device authorizations, keyed by device code. A DB backed
+// implementation can be swapped in by satisfying this interface; garm ships an
+// in-memory implementation that is sufficient for a single garm-server instance.
+type Store interface {
+	Create(userCode string) (deviceCode string, err error)
+	Get(deviceCode string) (DeviceCodeResponse, error)
+	Approve(userCode string) error
+	Deny(userCode string) error
+	// Poll records a poll attempt and returns whether the caller must slow down.
+	Poll(deviceCode string) (approved bool, denied bool, slowDown bool, err error)
+	Delete(deviceCode string) error
+}
+
+// InMemoryStore is a Store implementation backed by a map, suitable for a single
+// garm-server instance. Expired entries are pruned lazily, on access.
+type InMemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*deviceAuthorization
+}
+
+// NewInMemoryStore returns a ready to use InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		entries: map[string]*deviceAuthorization{},
+	}
+}
+
+func (s *InMemoryStore) Create(userCode string) (string, error) {
+	deviceCode, err := util.GetRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[deviceCode] = &deviceAuthorization{
+		userCode:  userCode,
+		expiresAt: time.Now().Add(DeviceCodeExpiry),
+		interval:  DefaultPollInterval * time.Second,
+	}
+	return deviceCode, nil
+}
+
+func (s *InMemoryStore) Get(deviceCode string) (DeviceCodeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[deviceCode]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(s.entries, deviceCode)
+		return DeviceCodeResponse{}, runnerErrors.NewNotFoundError("device code not found")
+	}
+
+	return DeviceCodeResponse{
+		DeviceCode: deviceCode,
+		UserCode:   entry.userCode,
+		ExpiresIn:  int(time.Until(entry.expiresAt).Seconds()),
+		Interval:   int(entry.interval.Seconds()),
+	}, nil
+}
+
+func (s *InMemoryStore) findByUserCode(userCode string) *deviceAuthorization {
+	for _, entry := range s.entries {
+		if entry.userCode == userCode {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) Approve(userCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.findByUserCode(userCode)
+	if entry == nil {
+		return runnerErrors.NewNotFoundError("user code not found")
+	}
+	entry.approved = true
+	return nil
+}
+
+func (s *InMemoryStore) Deny(userCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.findByUserCode(userCode)
+	if entry == nil {
+		return runnerErrors.NewNotFoundError("user code not found")
+	}
+	entry.denied = true
+	return nil
+}
+
+func (s *InMemoryStore) Poll(deviceCode string) (bool, bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[deviceCode]
+	if !ok || time.Now().After(entry.expiresAt) {
+		delete(s.entries, deviceCode)
+		return false, false, false, runnerErrors.NewNotFoundError("device code not found")
+	}
+
+	now := time.Now()
+	slowDown := !entry.lastPoll.IsZero() && now.Sub(entry.lastPoll) < entry.interval
+	if slowDown {
+		entry.interval += SlowDownIncrement
+	}
+	entry.lastPoll = now
+
+	return entry.approved, entry.denied, slowDown, nil
+}
+
+func (s *InMemoryStore) Delete(deviceCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, deviceCode)
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TokenFileName is the name of the file, inside the user's garm-cli config dir, that
+// holds the persisted device flow tokens.
+const TokenFileName = "device_token.json"
+
+// PersistedToken is what garm-cli stores on disk after a successful device login.
+type PersistedToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Expired returns true if the access token has expired or is about to, within skew.
+func (p PersistedToken) Expired(skew time.Duration) bool {
+	return time.Now().Add(skew).After(p.ExpiresAt)
+}
+
+// Client is the garm-cli side of the device authorization flow.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// OpenBrowser, when set, is called with the verification URI so it can be opened
+	// in the user's default browser. Left nil, garm-cli only prints the URL.
+	OpenBrowser func(url string) error
+}
+
+// NewClient returns a device flow Client talking to the garm server at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+	}
+}
+
+// Login runs the full RFC 8628 device authorization flow: it requests a device code,
+// prints (and optionally opens) the verification URL, then polls the token endpoint
+// until the user approves or denies the request, or it expires.
+func (c *Client) Login(ctx context.Context) (PersistedToken, error) {
+	deviceResp, err := c.requestDeviceCode(ctx)
+	if err != nil {
+		return PersistedToken{}, errors.Wrap(err, "requesting device code")
+	}
+
+	fmt.Printf("To authenticate, visit:\n\n    %s\n\nand enter code: %s\n\n", deviceResp.VerificationURI, deviceResp.UserCode)
+	if c.OpenBrowser != nil {
+		_ = c.OpenBrowser(deviceResp.VerificationURIComplete)
+	}
+
+	interval := time.Duration(deviceResp.Interval) * time.Second
+	if interval <= 0 {
+		interval = DefaultPollInterval * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(deviceResp.ExpiresIn) * time.Second)
+
+	for {
+		if time.Now().After(deadline) {
+			return PersistedToken{}, errors.New("device code expired")
+		}
+
+		select {
+		case <-ctx.Done():
+			return PersistedToken{}, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		tokenResp, err := c.pollToken(ctx, deviceResp.DeviceCode)
+		if err != nil {
+			return PersistedToken{}, errors.Wrap(err, "polling for token")
+		}
+
+		switch tokenResp.Error {
+		case "":
+			return PersistedToken{
+				AccessToken:  tokenResp.AccessToken,
+				RefreshToken: tokenResp.RefreshToken,
+				ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+			}, nil
+		case ErrAuthorizationPending:
+			continue
+		case ErrSlowDown:
+			interval += SlowDownIncrement
+		case ErrExpiredToken:
+			return PersistedToken{}, errors.New("device code expired")
+		case ErrAccessDenied:
+			return PersistedToken{}, errors.New("access denied")
+		default:
+			return PersistedToken{}, fmt.Errorf("unexpected error from token endpoint: %s", tokenResp.Error)
+		}
+	}
+}
+
+func (c *Client) requestDeviceCode(ctx context.Context) (DeviceCodeResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/device/code", nil)
+	if err != nil {
+		return DeviceCodeResponse{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return DeviceCodeResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var out DeviceCodeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return DeviceCodeResponse{}, errors.Wrap(err, "decoding response")
+	}
+	return out, nil
+}
+
+func (c *Client) pollToken(ctx context.Context, deviceCode string) (TokenResponse, error) {
+	body, err := json.Marshal(TokenRequest{DeviceCode: deviceCode})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/token", bytes.NewReader(body))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var out TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return TokenResponse{}, errors.Wrap(err, "decoding response")
+	}
+	return out, nil
+}
+
+// Refresh exchanges a refresh token for a new access token once the current one has
+// expired or is about to. garm-cli calls this transparently before issuing API requests.
+func (c *Client) Refresh(ctx context.Context, token PersistedToken) (PersistedToken, error) {
+	body, err := json.Marshal(struct {
+		RefreshToken string `json:"refresh_token"`
+	}{RefreshToken: token.RefreshToken})
+	if err != nil {
+		return PersistedToken{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/refresh", bytes.NewReader(body))
+	if err != nil {
+		return PersistedToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return PersistedToken{}, err
+	}
+	defer resp.Body.Close()
+
+	var out TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return PersistedToken{}, errors.Wrap(err, "decoding response")
+	}
+	if out.Error != "" {
+		return PersistedToken{}, fmt.Errorf("refreshing token: %s", out.Error)
+	}
+
+	return PersistedToken{
+		AccessToken:  out.AccessToken,
+		RefreshToken: out.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(out.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// SaveToken persists token to <configDir>/device_token.json with 0600 permissions.
+func SaveToken(configDir string, token PersistedToken) error {
+	if err := os.MkdirAll(configDir, 0o711); err != nil {
+		return errors.Wrap(err, "creating config dir")
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "marshaling token")
+	}
+
+	if err := os.WriteFile(filepath.Join(configDir, TokenFileName), data, 0o600); err != nil {
+		return errors.Wrap(err, "writing token file")
+	}
+	return nil
+}
+
+// LoadToken reads back a token previously persisted by SaveToken.
+func LoadToken(configDir string) (PersistedToken, error) {
+	data, err := os.ReadFile(filepath.Join(configDir, TokenFileName))
+	if err != nil {
+		return PersistedToken{}, errors.Wrap(err, "reading token file")
+	}
+
+	var token PersistedToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return PersistedToken{}, errors.Wrap(err, "unmarshaling token")
+	}
+	return token, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"garm/util"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceAuthorizer issues and verifies device codes. It is the server side counterpart
+// of Client, and is meant to be wired into the apiserver behind the /device/code and
+// /token routes.
+type DeviceAuthorizer struct {
+	store       Store
+	verifierURI string
+	// IssueToken mints the final access/refresh token pair for the garm user that
+	// approved the user_code. It is left as a callback so this package doesn't need
+	// to know about garm's user/JWT machinery.
+	IssueToken func(userCode string) (accessToken string, refreshToken string, expiresIn int, err error)
+}
+
+// NewDeviceAuthorizer returns a DeviceAuthorizer backed by store. verifierURI is the
+// URL users are told to visit to approve a pending device code (e.g. the garm web UI).
+func NewDeviceAuthorizer(store Store, verifierURI string) *DeviceAuthorizer {
+	return &DeviceAuthorizer{
+		store:       store,
+		verifierURI: verifierURI,
+	}
+}
+
+// RequestDeviceCode handles POST /device/code. It generates a new device_code/user_code
+// pair and hands it back to the caller, who is expected to display the user_code and
+// verification_uri to the end user.
+func (d *DeviceAuthorizer) RequestDeviceCode() (DeviceCodeResponse, error) {
+	userCode, err := newUserCode()
+	if err != nil {
+		return DeviceCodeResponse{}, errors.Wrap(err, "generating user code")
+	}
+
+	deviceCode, err := d.store.Create(userCode)
+	if err != nil {
+		return DeviceCodeResponse{}, errors.Wrap(err, "creating device authorization")
+	}
+
+	return DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         d.verifierURI,
+		VerificationURIComplete: fmt.Sprintf("%s?user_code=%s", d.verifierURI, userCode),
+		ExpiresIn:               int(DeviceCodeExpiry.Seconds()),
+		Interval:                DefaultPollInterval,
+	}, nil
+}
+
+// Token handles POST /token. It is expected to be called repeatedly by garm-cli until
+// it either gets back an access token, or a terminal error (expired_token, access_denied).
+func (d *DeviceAuthorizer) Token(req TokenRequest) TokenResponse {
+	info, err := d.store.Get(req.DeviceCode)
+	if err != nil {
+		return TokenResponse{Error: ErrExpiredToken}
+	}
+
+	approved, denied, slowDown, err := d.store.Poll(req.DeviceCode)
+	if err != nil {
+		return TokenResponse{Error: ErrExpiredToken}
+	}
+
+	switch {
+	case denied:
+		_ = d.store.Delete(req.DeviceCode)
+		return TokenResponse{Error: ErrAccessDenied}
+	case slowDown:
+		return TokenResponse{Error: ErrSlowDown}
+	case !approved:
+		return TokenResponse{Error: ErrAuthorizationPending}
+	}
+
+	accessToken, refreshToken, expiresIn, err := d.IssueToken(info.UserCode)
+	if err != nil {
+		return TokenResponse{Error: ErrAccessDenied}
+	}
+	_ = d.store.Delete(req.DeviceCode)
+
+	return TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    expiresIn,
+	}
+}
+
+// Approve marks the device authorization identified by userCode as approved. It is called
+// by the handler backing the verification_uri, once the logged in user confirms the code
+// displayed by garm-cli matches what they see in the browser.
+func (d *DeviceAuthorizer) Approve(userCode string) error {
+	return d.store.Approve(strings.ToUpper(userCode))
+}
+
+// Deny marks the device authorization identified by userCode as denied.
+func (d *DeviceAuthorizer) Deny(userCode string) error {
+	return d.store.Deny(strings.ToUpper(userCode))
+}
+
+// newUserCode returns an upper-case, dash separated code meant to be easy to read back
+// and type, along the lines of GitHub's own device flow (e.g. "WDJB-MJHT").
+func newUserCode() (string, error) {
+	part1, err := util.GetRandomString(4)
+	if err != nil {
+		return "", err
+	}
+	part2, err := util.GetRandomString(4)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(fmt.Sprintf("%s-%s", part1, part2)), nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// Package cache provides a small TTL cache used to sit in front of GitHub API calls
+// that return data which rarely changes within the lifetime of a pool scaling event
+// (e.g. the runner application download manifest). Spinning up dozens of runners at
+// once currently means dozens of identical calls to the same GitHub endpoint; caching
+// the response cuts rate-limit pressure and shaves seconds off pool scaling.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is used by callers that don't have a more specific freshness requirement
+// for the data they're caching.
+const DefaultTTL = 30 * time.Minute
+
+// Cache is a minimal, TTL aware key/value store. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	// Get returns the cached value for key, and whether it was found and not expired.
+	Get(key string) (value interface{}, ok bool)
+	// Set stores value under key, expiring it after ttl. A ttl of 0 means it never
+	// expires on its own (Delete is still honored).
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+}
+
+type entry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+func (e entry) expired() bool {
+	return !e.expiresAt.IsZero() && time.Now().After(e.expiresAt)
+}
+
+// InMemoryCache is a Cache implementation backed by a map. It does not run a
+// background sweeper; expired entries are pruned lazily, on the next Get/Set that
+// touches the same key.
+type InMemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]entry
+}
+
+// NewInMemoryCache returns a ready to use InMemoryCache.
+func NewInMemoryCache() *InMemoryCache {
+	return &InMemoryCache{
+		entries: map[string]entry{},
+	}
+}
+
+func (c *InMemoryCache) Get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if e.expired() {
+		c.Delete(key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *InMemoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry{
+		value:     value,
+		expiresAt: expiresAt,
+	}
+}
+
+func (c *InMemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+type cacheContextKey struct{}
+
+// WithCache returns a new context that carries c, retrievable via FromContext. This
+// lets tests swap in their own Cache (or none at all) without the cached code paths
+// needing a constructor argument threaded everywhere.
+func WithCache(ctx context.Context, c Cache) context.Context {
+	return context.WithValue(ctx, cacheContextKey{}, c)
+}
+
+// FromContext returns the Cache stored in ctx by WithCache, or a process wide default
+// InMemoryCache if none was set. It never returns nil, so callers can always use the
+// result without a nil check.
+func FromContext(ctx context.Context) Cache {
+	if c, ok := ctx.Value(cacheContextKey{}).(Cache); ok && c != nil {
+		return c
+	}
+	return defaultCache
+}
+
+var defaultCache = NewInMemoryCache()
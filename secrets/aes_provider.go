@@ -0,0 +1,128 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// AESPassphraseSealer is the original garm encryption scheme: AES-256-GCM keyed
+// directly off a 32 byte passphrase taken from the config file. It does not do
+// envelope encryption -- the "DEK" is the passphrase itself -- which is exactly the
+// footgun the other providers in this package exist to get away from, but it remains
+// the zero-config default.
+type AESPassphraseSealer struct {
+	keyID      string
+	passphrase string
+}
+
+// NewAESPassphraseSealer returns a Sealer backed by a 32 byte passphrase. keyID is an
+// arbitrary, operator chosen label used to tell apart passphrases across a rotation;
+// it is stored in the envelope header but never used to derive the key.
+func NewAESPassphraseSealer(keyID string, passphrase string) (*AESPassphraseSealer, error) {
+	if len(passphrase) != 32 {
+		return nil, errors.New("invalid passphrase length (expected length 32 characters)")
+	}
+	return &AESPassphraseSealer{
+		keyID:      keyID,
+		passphrase: passphrase,
+	}, nil
+}
+
+func (a *AESPassphraseSealer) Provider() Provider {
+	return ProviderAES256Passphrase
+}
+
+func (a *AESPassphraseSealer) KeyID() string {
+	return a.keyID
+}
+
+func (a *AESPassphraseSealer) Seal(plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher([]byte(a.passphrase))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating new aead")
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "creating nonce")
+	}
+
+	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
+
+	return encodeEnvelope(envelope{
+		Version:    headerVersion,
+		Provider:   a.Provider(),
+		KeyID:      a.keyID,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	}), nil
+}
+
+func (a *AESPassphraseSealer) Unseal(sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher([]byte(a.passphrase))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating new aead")
+	}
+
+	e, err := decodeEnvelope(sealed)
+	if err != nil {
+		// Pre-envelope records are a bare nonce||ciphertext blob with no header at
+		// all, so any failure to recognize the new format falls back to that layout.
+		// This is what lets `garm-cli secrets rewrap` (and this function) read
+		// everything encrypted before the envelope format existed.
+		return a.unsealLegacy(aesgcm, sealed)
+	}
+	if e.Provider != a.Provider() {
+		return nil, errors.Errorf("envelope sealed with provider %q, not %q", e.Provider, a.Provider())
+	}
+
+	plaintext, err := aesgcm.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt text")
+	}
+	return plaintext, nil
+}
+
+// unsealLegacy decrypts the pre-envelope format used by the original
+// Aes256EncodeString: a bare nonce, followed directly by the GCM sealed ciphertext.
+func (a *AESPassphraseSealer) unsealLegacy(aesgcm cipher.AEAD, sealed []byte) ([]byte, error) {
+	nonceSize := aesgcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("failed to decrypt text")
+	}
+
+	nonce, ciphertext := sealed[:nonceSize], sealed[nonceSize:]
+	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt text")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// kekWrapper wraps and unwraps a per-record data encryption key (DEK) under a key
+// encryption key (KEK) held by an external service. Each envelope provider in this
+// file (Vault Transit, AWS KMS, GCP KMS, age) only needs to implement this, and gets
+// full envelope encryption (Seal/Unseal, independent of the KEK) for free from
+// envelopeSealer below.
+type kekWrapper interface {
+	keyID() string
+	wrapDEK(dek []byte) ([]byte, error)
+	unwrapDEK(wrapped []byte) ([]byte, error)
+}
+
+// envelopeSealer implements Sealer on top of a kekWrapper: it generates a random DEK
+// per record, seals the plaintext with it using AES-256-GCM, and asks the wrapper to
+// wrap/unwrap the DEK. Only the wrapped DEK is stored in the envelope. secrets.Rewrap
+// moves a record to a new KEK by unsealing it and sealing the plaintext again under a
+// fresh DEK; it does not re-wrap the existing DEK in place.
+type envelopeSealer struct {
+	provider Provider
+	wrapper  kekWrapper
+}
+
+func (e *envelopeSealer) Provider() Provider {
+	return e.provider
+}
+
+func (e *envelopeSealer) KeyID() string {
+	return e.wrapper.keyID()
+}
+
+func (e *envelopeSealer) Seal(plaintext []byte) ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, errors.Wrap(err, "generating DEK")
+	}
+	defer zero(dek)
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating aead")
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "creating nonce")
+	}
+	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
+
+	wrappedDEK, err := e.wrapper.wrapDEK(dek)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrapping DEK")
+	}
+
+	return encodeEnvelope(envelope{
+		Version:    headerVersion,
+		Provider:   e.provider,
+		KeyID:      e.wrapper.keyID(),
+		WrappedDEK: wrappedDEK,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	}), nil
+}
+
+func (e *envelopeSealer) Unseal(sealed []byte) ([]byte, error) {
+	env, err := decodeEnvelope(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if env.Provider != e.provider {
+		return nil, errors.Errorf("envelope sealed with provider %q, not %q", env.Provider, e.provider)
+	}
+
+	dek, err := e.wrapper.unwrapDEK(env.WrappedDEK)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrapping DEK")
+	}
+	defer zero(dek)
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating aead")
+	}
+
+	plaintext, err := aesgcm.Open(nil, env.Nonce, env.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt text")
+	}
+	return plaintext, nil
+}
+
+// VaultTransitConfig configures a Sealer backed by a HashiCorp Vault Transit key.
+type VaultTransitConfig struct {
+	Address   string
+	Token     string
+	MountPath string
+	KeyName   string
+}
+
+// NewVaultTransitSealer returns a Sealer that wraps/unwraps DEKs via Vault's Transit
+// encrypt/decrypt endpoints (transit/encrypt/<key>, transit/decrypt/<key>). The actual
+// Vault API client is intentionally left pluggable (transitClient) so this package
+// doesn't force a hashicorp/vault/api dependency on callers who don't use this backend.
+func NewVaultTransitSealer(cfg VaultTransitConfig, client transitClient) Sealer {
+	return &envelopeSealer{
+		provider: ProviderVaultTransit,
+		wrapper: &vaultWrapper{
+			cfg:    cfg,
+			client: client,
+		},
+	}
+}
+
+// transitClient abstracts the subset of the Vault Transit API a kekWrapper needs.
+type transitClient interface {
+	Encrypt(mountPath, keyName string, plaintext []byte) (ciphertext string, err error)
+	Decrypt(mountPath, keyName string, ciphertext string) (plaintext []byte, err error)
+}
+
+type vaultWrapper struct {
+	cfg    VaultTransitConfig
+	client transitClient
+}
+
+func (v *vaultWrapper) keyID() string {
+	return v.cfg.KeyName
+}
+
+func (v *vaultWrapper) wrapDEK(dek []byte) ([]byte, error) {
+	ciphertext, err := v.client.Encrypt(v.cfg.MountPath, v.cfg.KeyName, dek)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(ciphertext), nil
+}
+
+func (v *vaultWrapper) unwrapDEK(wrapped []byte) ([]byte, error) {
+	return v.client.Decrypt(v.cfg.MountPath, v.cfg.KeyName, string(wrapped))
+}
+
+// KMSClient abstracts the subset of a cloud KMS API (AWS KMS GenerateDataKey/Decrypt,
+// or GCP KMS Encrypt/Decrypt) needed to wrap and unwrap a DEK. Concrete callers pass in
+// an adapter around the aws-sdk-go-v2 or cloud.google.com/go/kms client.
+type KMSClient interface {
+	Encrypt(keyID string, plaintext []byte) (ciphertext []byte, err error)
+	Decrypt(keyID string, ciphertext []byte) (plaintext []byte, err error)
+}
+
+type kmsWrapper struct {
+	keyName string
+	client  KMSClient
+}
+
+func (k *kmsWrapper) keyID() string {
+	return k.keyName
+}
+
+func (k *kmsWrapper) wrapDEK(dek []byte) ([]byte, error) {
+	return k.client.Encrypt(k.keyName, dek)
+}
+
+func (k *kmsWrapper) unwrapDEK(wrapped []byte) ([]byte, error) {
+	return k.client.Decrypt(k.keyName, wrapped)
+}
+
+// NewAWSKMSSealer returns a Sealer that wraps/unwraps DEKs via an AWS KMS CMK, keyID
+// being the key's ARN or alias.
+func NewAWSKMSSealer(keyID string, client KMSClient) Sealer {
+	return &envelopeSealer{
+		provider: ProviderAWSKMS,
+		wrapper:  &kmsWrapper{keyName: keyID, client: client},
+	}
+}
+
+// NewGCPKMSSealer returns a Sealer that wraps/unwraps DEKs via a GCP Cloud KMS key,
+// keyID being the key's full resource name.
+func NewGCPKMSSealer(keyID string, client KMSClient) Sealer {
+	return &envelopeSealer{
+		provider: ProviderGCPKMS,
+		wrapper:  &kmsWrapper{keyName: keyID, client: client},
+	}
+}
+
+// AgeRecipient abstracts an age (or PGP) recipient/identity pair used to wrap/unwrap a
+// DEK without a running KMS service, e.g. for single-operator or air-gapped setups.
+type AgeRecipient interface {
+	Recipient() string
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+type ageWrapper struct {
+	recipient AgeRecipient
+}
+
+func (a *ageWrapper) keyID() string {
+	return a.recipient.Recipient()
+}
+
+func (a *ageWrapper) wrapDEK(dek []byte) ([]byte, error) {
+	return a.recipient.Encrypt(dek)
+}
+
+func (a *ageWrapper) unwrapDEK(wrapped []byte) ([]byte, error) {
+	return a.recipient.Decrypt(wrapped)
+}
+
+// NewAgeSealer returns a Sealer that wraps/unwraps DEKs for a single age (or PGP)
+// recipient, suitable for operators who don't want to run a KMS or Vault.
+func NewAgeSealer(recipient AgeRecipient) Sealer {
+	return &envelopeSealer{
+		provider: ProviderAge,
+		wrapper:  &ageWrapper{recipient: recipient},
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package secrets
+
+import (
+	"github.com/pkg/errors"
+)
+
+// EncryptedRecord is one row of encrypted data in garm's DB -- a github token, a
+// webhook secret, an instance token -- identified by an opaque ID meaningful to
+// Store.Update.
+type EncryptedRecord struct {
+	ID     string
+	Sealed []byte
+}
+
+// Store is the subset of garm's DB layer that `garm-cli secrets rewrap` needs: list
+// every encrypted column across every table, and write back the re-sealed value.
+type Store interface {
+	ListEncryptedRecords() ([]EncryptedRecord, error)
+	UpdateEncryptedRecord(id string, sealed []byte) error
+}
+
+// sealerKey identifies a Sealer by both its Provider and its KeyID, since a single
+// provider can have more than one key in flight at once -- e.g. two generations of the
+// AES passphrase, both ProviderAES256Passphrase, mid-rotation.
+type sealerKey struct {
+	provider Provider
+	keyID    string
+}
+
+// Rewrapper re-seals every encrypted record in a Store under a new Sealer. oldSealers
+// can hold more than one Sealer per Provider (e.g. two AES passphrases mid-rotation);
+// each is looked up by its own (Provider, KeyID) pair, so a deployment with old
+// records sealed under the previous KEK and new ones under the current one can still
+// decrypt everything.
+type Rewrapper struct {
+	store      Store
+	oldSealers map[sealerKey]Sealer
+	newSealer  Sealer
+}
+
+// NewRewrapper returns a Rewrapper that moves every record in store to newSealer,
+// using oldSealers to decrypt whatever provider/key each record is currently under.
+// oldSealers may contain several Sealers for the same Provider, as long as each has a
+// distinct KeyID.
+func NewRewrapper(store Store, oldSealers []Sealer, newSealer Sealer) *Rewrapper {
+	byKey := make(map[sealerKey]Sealer, len(oldSealers))
+	for _, sealer := range oldSealers {
+		byKey[sealerKey{provider: sealer.Provider(), keyID: sealer.KeyID()}] = sealer
+	}
+
+	return &Rewrapper{
+		store:      store,
+		oldSealers: byKey,
+		newSealer:  newSealer,
+	}
+}
+
+// RewrapAllResult summarizes the outcome of a RewrapAll run.
+type RewrapAllResult struct {
+	Rewrapped int
+	Skipped   int
+}
+
+// RewrapAll iterates every encrypted record returned by the store, re-sealing it under
+// the configured newSealer and persisting the result. Records already sealed under
+// newSealer's provider/key are left untouched and counted as Skipped.
+func (r *Rewrapper) RewrapAll() (RewrapAllResult, error) {
+	records, err := r.store.ListEncryptedRecords()
+	if err != nil {
+		return RewrapAllResult{}, errors.Wrap(err, "listing encrypted records")
+	}
+
+	var result RewrapAllResult
+	for _, record := range records {
+		provider, keyID, err := ProviderOf(record.Sealed)
+		if err != nil {
+			return result, errors.Wrapf(err, "inspecting record %s", record.ID)
+		}
+
+		if provider == r.newSealer.Provider() && keyID == r.newSealer.KeyID() {
+			result.Skipped++
+			continue
+		}
+
+		oldSealer, ok := r.oldSealers[sealerKey{provider: provider, keyID: keyID}]
+		if !ok {
+			return result, errors.Errorf("no sealer registered for provider %q key %q used by record %s", provider, keyID, record.ID)
+		}
+
+		rewrapped, err := Rewrap(record.Sealed, oldSealer, r.newSealer)
+		if err != nil {
+			return result, errors.Wrapf(err, "rewrapping record %s", record.ID)
+		}
+
+		if err := r.store.UpdateEncryptedRecord(record.ID, rewrapped); err != nil {
+			return result, errors.Wrapf(err, "persisting rewrapped record %s", record.ID)
+		}
+		result.Rewrapped++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	records map[string][]byte
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{records: map[string][]byte{}}
+}
+
+func (f *fakeStore) ListEncryptedRecords() ([]EncryptedRecord, error) {
+	records := make([]EncryptedRecord, 0, len(f.records))
+	for id, sealed := range f.records {
+		records = append(records, EncryptedRecord{ID: id, Sealed: sealed})
+	}
+	return records, nil
+}
+
+func (f *fakeStore) UpdateEncryptedRecord(id string, sealed []byte) error {
+	f.records[id] = sealed
+	return nil
+}
+
+func TestRewrapAllMovesEveryRecordToTheNewProvider(t *testing.T) {
+	oldSealer, err := NewAESPassphraseSealer("old-key", "01234567890123456789012345678901")
+	require.NoError(t, err)
+
+	store := newFakeStore()
+	for id, plaintext := range map[string]string{
+		"github-token-1":   "ghp_one",
+		"webhook-secret-1": "whsec_one",
+	} {
+		sealed, err := oldSealer.Seal([]byte(plaintext))
+		require.NoError(t, err)
+		store.records[id] = sealed
+	}
+
+	newSealer := NewAWSKMSSealer("arn:aws:kms:new-key", newFakeKMS(t))
+	rewrapper := NewRewrapper(store, []Sealer{oldSealer}, newSealer)
+
+	result, err := rewrapper.RewrapAll()
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Rewrapped)
+	require.Equal(t, 0, result.Skipped)
+
+	for id, want := range map[string]string{
+		"github-token-1":   "ghp_one",
+		"webhook-secret-1": "whsec_one",
+	} {
+		plaintext, err := newSealer.Unseal(store.records[id])
+		require.NoError(t, err)
+		require.Equal(t, want, string(plaintext))
+	}
+
+	// Running it again is a no-op: every record is already sealed under newSealer.
+	result, err = rewrapper.RewrapAll()
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Rewrapped)
+	require.Equal(t, 2, result.Skipped)
+}
+
+func TestRewrapAllResolvesMultipleKeysForTheSameProvider(t *testing.T) {
+	// Two generations of the same AES passphrase provider, as you'd see mid-rotation:
+	// some records are still sealed under the older key.
+	olderSealer, err := NewAESPassphraseSealer("key-gen-1", "01234567890123456789012345678901")
+	require.NoError(t, err)
+	newerSealer, err := NewAESPassphraseSealer("key-gen-2", "zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz")
+	require.NoError(t, err)
+
+	store := newFakeStore()
+	olderSealed, err := olderSealer.Seal([]byte("sealed under gen 1"))
+	require.NoError(t, err)
+	store.records["record-gen-1"] = olderSealed
+
+	newerSealed, err := newerSealer.Seal([]byte("sealed under gen 2"))
+	require.NoError(t, err)
+	store.records["record-gen-2"] = newerSealed
+
+	finalSealer := NewAWSKMSSealer("arn:aws:kms:final-key", newFakeKMS(t))
+	rewrapper := NewRewrapper(store, []Sealer{olderSealer, newerSealer}, finalSealer)
+
+	result, err := rewrapper.RewrapAll()
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Rewrapped)
+	require.Equal(t, 0, result.Skipped)
+
+	plaintext, err := finalSealer.Unseal(store.records["record-gen-1"])
+	require.NoError(t, err)
+	require.Equal(t, "sealed under gen 1", string(plaintext))
+
+	plaintext, err = finalSealer.Unseal(store.records["record-gen-2"])
+	require.NoError(t, err)
+	require.Equal(t, "sealed under gen 2", string(plaintext))
+}
+
+func TestRewrapAllErrorsOnUnknownProvider(t *testing.T) {
+	oldSealer, err := NewAESPassphraseSealer("old-key", "01234567890123456789012345678901")
+	require.NoError(t, err)
+
+	sealed, err := oldSealer.Seal([]byte("orphaned"))
+	require.NoError(t, err)
+
+	store := newFakeStore()
+	store.records["orphan"] = sealed
+
+	newSealer := NewAWSKMSSealer("arn:aws:kms:new-key", newFakeKMS(t))
+	// Note: no old sealer registered at all.
+	rewrapper := NewRewrapper(store, nil, newSealer)
+
+	_, err = rewrapper.RewrapAll()
+	require.Error(t, err)
+}
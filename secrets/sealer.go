@@ -0,0 +1,184 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// Package secrets holds garm's encryption-at-rest abstractions. Every secret garm
+// stores in its DB (github tokens, webhook secrets, instance tokens) goes through a
+// Sealer rather than talking to a specific crypto primitive directly, so the backend
+// can be swapped (or the key rotated) without touching callers.
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// headerVersion is bumped whenever the on-disk envelope format changes in an
+// incompatible way.
+const headerVersion = 1
+
+// Provider identifies which Sealer implementation produced a given ciphertext. It is
+// stored, unencrypted, in the envelope header so a record can always be routed back to
+// the provider/key that can decrypt it, even after the deployment's default provider
+// has moved on to something else.
+type Provider string
+
+const (
+	ProviderAES256Passphrase Provider = "aes256"
+	ProviderVaultTransit     Provider = "vault-transit"
+	ProviderAWSKMS           Provider = "aws-kms"
+	ProviderGCPKMS           Provider = "gcp-kms"
+	ProviderAge              Provider = "age"
+)
+
+// Sealer seals (encrypts) and unseals (decrypts) plaintext secrets. Implementations are
+// free to use envelope encryption internally (wrap a per-record DEK with a KEK held by
+// a KMS/Vault/age recipient) or, like the passphrase provider, work directly on the
+// plaintext; either way the returned ciphertext is a self-describing envelope that
+// Unseal (on any provider registered for the same KeyID) can open.
+type Sealer interface {
+	// Provider returns the identifier this Sealer seals records under.
+	Provider() Provider
+	// KeyID identifies which key, within Provider, was used. This allows rotating the
+	// KEK without bumping Provider, and without breaking records sealed under the
+	// previous key, as long as the old key remains resolvable by the same Sealer.
+	KeyID() string
+	Seal(plaintext []byte) ([]byte, error)
+	Unseal(envelope []byte) ([]byte, error)
+}
+
+// envelope is the versioned, self-describing wrapper every Sealer.Seal result is
+// packed into. WrappedDEK is optional and only populated by providers that do envelope
+// encryption (KMS/Vault/age); the passphrase provider leaves it empty and fills in only
+// Nonce and Ciphertext.
+type envelope struct {
+	Version    uint8
+	Provider   Provider
+	KeyID      string
+	WrappedDEK []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// encodeEnvelope serializes e into the opaque blob that gets stored in the DB column.
+// The format is intentionally simple (length-prefixed fields) rather than a generic
+// serialization format, so it has no dependency surface of its own.
+func encodeEnvelope(e envelope) []byte {
+	buf := []byte{e.Version}
+	buf = appendLV(buf, []byte(e.Provider))
+	buf = appendLV(buf, []byte(e.KeyID))
+	buf = appendLV(buf, e.WrappedDEK)
+	buf = appendLV(buf, e.Nonce)
+	buf = appendLV(buf, e.Ciphertext)
+	return buf
+}
+
+func decodeEnvelope(data []byte) (envelope, error) {
+	if len(data) < 1 {
+		return envelope{}, fmt.Errorf("envelope too short")
+	}
+
+	var e envelope
+	e.Version = data[0]
+	if e.Version != headerVersion {
+		return envelope{}, fmt.Errorf("unsupported envelope version %d", e.Version)
+	}
+	rest := data[1:]
+
+	fields := make([][]byte, 5)
+	for i := range fields {
+		var field []byte
+		var err error
+		field, rest, err = readLV(rest)
+		if err != nil {
+			return envelope{}, errors.Wrap(err, "decoding envelope")
+		}
+		fields[i] = field
+	}
+
+	e.Provider = Provider(fields[0])
+	e.KeyID = string(fields[1])
+	e.WrappedDEK = fields[2]
+	e.Nonce = fields[3]
+	e.Ciphertext = fields[4]
+	return e, nil
+}
+
+func appendLV(buf []byte, field []byte) []byte {
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(field)))
+	buf = append(buf, lenBuf...)
+	return append(buf, field...)
+}
+
+func readLV(buf []byte) (field []byte, rest []byte, err error) {
+	if len(buf) < 4 {
+		return nil, nil, fmt.Errorf("truncated field length")
+	}
+	length := binary.BigEndian.Uint32(buf[:4])
+	buf = buf[4:]
+	if uint32(len(buf)) < length {
+		return nil, nil, fmt.Errorf("truncated field")
+	}
+	return buf[:length], buf[length:], nil
+}
+
+// LegacyAESPassphraseKeyID is the KeyID reported by ProviderOf for ciphertexts written
+// before the envelope format existed: a bare AES-256-GCM nonce||ciphertext blob with no header of its own. Since
+// that format predates Provider/KeyID entirely, there is only one such pairing.
+const LegacyAESPassphraseKeyID = "legacy-config-passphrase"
+
+// ProviderOf peeks at a sealed envelope and returns which provider/key sealed it,
+// without decrypting it. garm-cli secrets rewrap uses this to pick the right Sealer
+// for each DB record. Blobs that predate the envelope format (no recognizable header)
+// are reported as ProviderAES256Passphrase/LegacyAESPassphraseKeyID, the only
+// provider/key pairing that ever wrote that format.
+func ProviderOf(sealed []byte) (Provider, string, error) {
+	e, err := decodeEnvelope(sealed)
+	if err != nil {
+		return ProviderAES256Passphrase, LegacyAESPassphraseKeyID, nil
+	}
+	return e.Provider, e.KeyID, nil
+}
+
+// Rewrap decrypts sealed with oldSealer and re-encrypts the resulting plaintext with
+// newSealer, returning the new envelope. The plaintext never touches disk.
+func Rewrap(sealed []byte, oldSealer, newSealer Sealer) ([]byte, error) {
+	plaintext, err := oldSealer.Unseal(sealed)
+	if err != nil {
+		return nil, errors.Wrap(err, "unsealing with old provider")
+	}
+	defer zero(plaintext)
+
+	return newSealer.Seal(plaintext)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// EncodeToString is a convenience helper for callers (like the DB layer) that store
+// secrets as strings rather than raw bytes.
+func EncodeToString(sealed []byte) string {
+	return base64.StdEncoding.EncodeToString(sealed)
+}
+
+// DecodeFromString is the inverse of EncodeToString.
+func DecodeFromString(encoded string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKMS is an in-memory KMSClient stand-in that "wraps" a DEK by encrypting it under
+// a fixed key, good enough to exercise envelopeSealer without a real KMS.
+type fakeKMS struct {
+	key []byte
+}
+
+func newFakeKMS(t *testing.T) *fakeKMS {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, key)
+	require.NoError(t, err)
+	return &fakeKMS{key: key}
+}
+
+func (f *fakeKMS) aesgcm() cipher.AEAD {
+	block, err := aes.NewCipher(f.key)
+	if err != nil {
+		panic(err)
+	}
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aesgcm
+}
+
+func (f *fakeKMS) Encrypt(keyID string, plaintext []byte) ([]byte, error) {
+	aesgcm := f.aesgcm()
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aesgcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (f *fakeKMS) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	aesgcm := f.aesgcm()
+	nonceSize := aesgcm.NonceSize()
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return aesgcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func TestAESPassphraseSealerRoundTrip(t *testing.T) {
+	sealer, err := NewAESPassphraseSealer("test-key", "01234567890123456789012345678901")
+	require.NoError(t, err)
+
+	sealed, err := sealer.Seal([]byte("super secret github token"))
+	require.NoError(t, err)
+	require.NotEmpty(t, sealed)
+
+	plaintext, err := sealer.Unseal(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "super secret github token", string(plaintext))
+}
+
+func TestAESPassphraseSealerRejectsWrongPassphrase(t *testing.T) {
+	sealer, err := NewAESPassphraseSealer("test-key", "01234567890123456789012345678901")
+	require.NoError(t, err)
+
+	sealed, err := sealer.Seal([]byte("super secret github token"))
+	require.NoError(t, err)
+
+	other, err := NewAESPassphraseSealer("test-key", "zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz")
+	require.NoError(t, err)
+
+	_, err = other.Unseal(sealed)
+	require.Error(t, err)
+}
+
+func TestAESPassphraseSealerReadsLegacyFormat(t *testing.T) {
+	passphrase := "01234567890123456789012345678901"
+
+	// Pre-envelope records were a bare nonce||ciphertext blob, produced by what is
+	// now Aes256EncodeString's body, before it delegated to this package.
+	block, err := aes.NewCipher([]byte(passphrase))
+	require.NoError(t, err)
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, aesgcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	require.NoError(t, err)
+	legacy := aesgcm.Seal(nonce, nonce, []byte("old webhook secret"), nil)
+
+	sealer, err := NewAESPassphraseSealer("test-key", passphrase)
+	require.NoError(t, err)
+
+	plaintext, err := sealer.Unseal(legacy)
+	require.NoError(t, err)
+	require.Equal(t, "old webhook secret", string(plaintext))
+
+	provider, keyID, err := ProviderOf(legacy)
+	require.NoError(t, err)
+	require.Equal(t, ProviderAES256Passphrase, provider)
+	require.Equal(t, LegacyAESPassphraseKeyID, keyID)
+}
+
+func TestEnvelopeSealerRoundTrip(t *testing.T) {
+	kms := newFakeKMS(t)
+	sealer := NewAWSKMSSealer("arn:aws:kms:test-key", kms)
+
+	sealed, err := sealer.Seal([]byte("another secret"))
+	require.NoError(t, err)
+
+	plaintext, err := sealer.Unseal(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "another secret", string(plaintext))
+
+	provider, keyID, err := ProviderOf(sealed)
+	require.NoError(t, err)
+	require.Equal(t, ProviderAWSKMS, provider)
+	require.Equal(t, "arn:aws:kms:test-key", keyID)
+}
+
+func TestRewrapAcrossProviders(t *testing.T) {
+	oldSealer, err := NewAESPassphraseSealer("old-key", "01234567890123456789012345678901")
+	require.NoError(t, err)
+
+	sealed, err := oldSealer.Seal([]byte("rotate me"))
+	require.NoError(t, err)
+
+	newSealer := NewAWSKMSSealer("arn:aws:kms:new-key", newFakeKMS(t))
+
+	rewrapped, err := Rewrap(sealed, oldSealer, newSealer)
+	require.NoError(t, err)
+
+	plaintext, err := newSealer.Unseal(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, "rotate me", string(plaintext))
+
+	provider, keyID, err := ProviderOf(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, ProviderAWSKMS, provider)
+	require.Equal(t, "arn:aws:kms:new-key", keyID)
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package util
+
+import (
+	"net/http"
+	"strings"
+
+	"garm/params"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/pkg/errors"
+)
+
+// newAppInstallationTransport returns an http.RoundTripper backed by a GitHub App
+// installation. The transport takes care of signing the app JWT with RS256, exchanging
+// it for an installation access token and caching that token until shortly before it
+// expires, transparently minting a new one on the next request. Since it implements
+// http.RoundTripper, it is a drop in replacement for the oauth2 transport used by the
+// PAT based flow, and every caller of GithubClient keeps working unmodified.
+//
+// apiBaseURL, when non-empty, points the token minting calls (JWT -> installation
+// token exchange) at a GitHub Enterprise Server instance instead of public GitHub,
+// matching the API client built from the same credsDetails.APIBaseURL in GithubClient.
+func newAppInstallationTransport(base http.RoundTripper, app params.GithubApp, apiBaseURL string) (http.RoundTripper, error) {
+	if app.AppID == 0 {
+		return nil, errors.New("missing app ID")
+	}
+	if app.InstallationID == 0 {
+		return nil, errors.New("missing installation ID")
+	}
+	if len(app.PrivateKeyBytes) == 0 {
+		return nil, errors.New("missing app private key")
+	}
+
+	itr, err := ghinstallation.New(base, app.AppID, app.InstallationID, app.PrivateKeyBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating installation transport")
+	}
+
+	if apiBaseURL != "" {
+		itr.BaseURL = strings.TrimSuffix(apiBaseURL, "/")
+	}
+
+	return itr, nil
+}
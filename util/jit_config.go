@@ -0,0 +1,74 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"garm/params"
+
+	"github.com/google/go-github/v48/github"
+	"github.com/pkg/errors"
+)
+
+// jitConfigClient is the subset of the go-github Actions API needed to mint a
+// just-in-time runner config. It is satisfied by *github.ActionsService, i.e. by the
+// common.GithubClient returned from GithubClient.
+type jitConfigClient interface {
+	GenerateRepoJITConfig(ctx context.Context, owner, repo string, request *github.GenerateJITConfigRequest) (*github.JITRunnerConfig, *github.Response, error)
+	GenerateOrgJITConfig(ctx context.Context, org string, request *github.GenerateJITConfigRequest) (*github.JITRunnerConfig, *github.Response, error)
+	GenerateEnterpriseJITConfig(ctx context.Context, enterprise string, request *github.GenerateJITConfigRequest) (*github.JITRunnerConfig, *github.Response, error)
+}
+
+// GenerateJITConfig calls GitHub's generate-jitconfig API for the given entity and
+// returns the base64 encoded_jit_config runners pass to `run.sh --jitconfig`. Unlike a
+// registration token, the result is single-use and already bound to runnerName,
+// labels and runnerGroup, so a leaked copy of it (e.g. sitting in cloud-init user-data)
+// cannot be replayed to register a different runner.
+func GenerateJITConfig(ctx context.Context, ghc jitConfigClient, entity params.GithubEntity, runnerName string, labels []string, runnerGroupID int64) (string, error) {
+	req := &github.GenerateJITConfigRequest{
+		Name:          runnerName,
+		RunnerGroupID: runnerGroupID,
+		Labels:        labels,
+	}
+
+	var (
+		jitConfig *github.JITRunnerConfig
+		err       error
+	)
+
+	switch entity.EntityType {
+	case params.GithubEntityTypeRepository:
+		// For a repository entity, Owner/Name is the (owner, repo) pair.
+		jitConfig, _, err = ghc.GenerateRepoJITConfig(ctx, entity.Owner, entity.Name, req)
+	case params.GithubEntityTypeOrganization:
+		// Org/enterprise entities have no separate "owner" -- Name carries the
+		// org/enterprise login itself.
+		jitConfig, _, err = ghc.GenerateOrgJITConfig(ctx, entity.Name, req)
+	case params.GithubEntityTypeEnterprise:
+		jitConfig, _, err = ghc.GenerateEnterpriseJITConfig(ctx, entity.Name, req)
+	default:
+		return "", fmt.Errorf("unknown github entity type %q", entity.EntityType)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "generating JIT config")
+	}
+	if jitConfig == nil || jitConfig.EncodedJITConfig == nil {
+		return "", fmt.Errorf("empty JIT config returned by github")
+	}
+
+	return *jitConfig.EncodedJITConfig, nil
+}
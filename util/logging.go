@@ -0,0 +1,154 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"garm/config"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Structured log field names shared across garm, so that every component (pool
+// manager, webhook handler, apiserver) tags its lines the same way and they can be
+// correlated with a single grep/jq filter regardless of which package emitted them.
+const (
+	FieldRunnerName       = "runner_name"
+	FieldPoolID           = "pool_id"
+	FieldProvider         = "provider"
+	FieldEntity           = "entity"
+	FieldGithubDeliveryID = "github_delivery_id"
+	FieldTraceID          = "trace_id"
+)
+
+type traceIDContextKey struct{}
+
+// WithTraceID returns a new context carrying traceID, retrievable via TraceIDFromContext
+// and automatically attached by LoggerFromContext to every log line.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDContextKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace ID stashed in ctx by WithTraceID, or "" if none
+// was set.
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDContextKey{}).(string)
+	return traceID
+}
+
+// NewLogger builds the process wide zerolog.Logger from cfg. It honors cfg.Default.LogFormat
+// ("json", the default, or "text") and cfg.Default.LogLevel ("debug", "info", "warn", "error";
+// defaults to "info" on an empty or invalid value). The writer produced by GetLoggingWriter
+// (stdout, or a rotating lumberjack sink when cfg.Default.LogFile is set) is kept as-is; this
+// only changes how lines are formatted before they reach it. When cfg.Default.SyslogAddress is
+// set, logs are additionally written to the given syslog endpoint, for deployments that
+// integrate logging at the host level rather than via stdout scraping.
+func NewLogger(cfg *config.Config) (zerolog.Logger, error) {
+	writer, err := GetLoggingWriter(cfg)
+	if err != nil {
+		return zerolog.Logger{}, errors.Wrap(err, "getting log writer")
+	}
+
+	level, err := zerolog.ParseLevel(strings.ToLower(cfg.Default.LogLevel))
+	if err != nil || cfg.Default.LogLevel == "" {
+		level = zerolog.InfoLevel
+	}
+
+	var sink io.Writer
+	switch strings.ToLower(cfg.Default.LogFormat) {
+	case "text":
+		sink = zerolog.ConsoleWriter{Out: writer, NoColor: true}
+	default:
+		sink = writer
+	}
+
+	if cfg.Default.SyslogAddress != "" {
+		syslogWriter, err := newSyslogWriter(cfg.Default.SyslogAddress)
+		if err != nil {
+			return zerolog.Logger{}, errors.Wrap(err, "dialing syslog")
+		}
+		sink = zerolog.MultiLevelWriter(sink, syslogWriter)
+	}
+	out := zerolog.New(sink).Level(level).With().Timestamp().Logger()
+
+	// Also set the package-global logger, so that LoggerFromContext has something
+	// backed by the configured sink to fall back to for contexts that were never
+	// threaded through WithLogger.
+	log.Logger = out
+
+	return out, nil
+}
+
+type loggerContextKey struct{}
+
+// WithLogger returns a new context carrying logger, retrievable via LoggerFromContext.
+func WithLogger(ctx context.Context, logger zerolog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the logger stashed in ctx by WithLogger, falling back to
+// the package-global logger (log.Logger, set up by NewLogger at startup) if none was
+// set. Note this deliberately does not fall back to zerolog.Ctx(ctx): on a context
+// with no logger attached, that returns a disabled, no-op logger, which would silently
+// drop every line logged from a bare context instead of sending it to the configured
+// sink.
+func LoggerFromContext(ctx context.Context) zerolog.Logger {
+	logger, ok := ctx.Value(loggerContextKey{}).(zerolog.Logger)
+	if !ok {
+		logger = log.Logger
+	}
+
+	if traceID := TraceIDFromContext(ctx); traceID != "" {
+		logger = logger.With().Str(FieldTraceID, traceID).Logger()
+	}
+	return logger
+}
+
+// WebhookEventLogger returns a logger pre-tagged with the correlation fields relevant
+// to a single incoming webhook delivery, so every line emitted while handling it can be
+// traced back to the originating GitHub delivery without grepping for a raw UUID.
+func WebhookEventLogger(ctx context.Context, entity, deliveryID string) zerolog.Logger {
+	return LoggerFromContext(ctx).With().
+		Str(FieldEntity, entity).
+		Str(FieldGithubDeliveryID, deliveryID).
+		Logger()
+}
+
+// RunnerLogger returns a logger pre-tagged with the correlation fields relevant to a
+// single runner instance, so its entire lifecycle (create, bootstrap, delete) can be
+// traced across the pool manager and providers.
+func RunnerLogger(ctx context.Context, poolID, provider, runnerName string) zerolog.Logger {
+	return LoggerFromContext(ctx).With().
+		Str(FieldPoolID, poolID).
+		Str(FieldProvider, provider).
+		Str(FieldRunnerName, runnerName).
+		Logger()
+}
+
+// NewTraceID returns a short, random identifier suitable for correlating the log lines
+// of a single API request or webhook delivery.
+func NewTraceID() (string, error) {
+	id, err := GetRandomString(16)
+	if err != nil {
+		return "", fmt.Errorf("generating trace id: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+//go:build !windows
+
+package util
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// newSyslogWriter dials a syslog daemon at address, for host-integrated deployments
+// that want garm's logs collected alongside everything else on the box. log/syslog has
+// no Windows implementation, so this lives behind a build tag; see
+// logging_syslog_windows.go for the stub garm-cli (which ships on Windows) links
+// against instead.
+func newSyslogWriter(address string) (io.Writer, error) {
+	return syslog.Dial("udp", address, syslog.LOG_INFO, "garm")
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+//go:build windows
+
+package util
+
+import (
+	"fmt"
+	"io"
+)
+
+// newSyslogWriter always fails on Windows: the standard library's log/syslog has no
+// Windows implementation, and garm-cli (which imports this package) ships as a Windows
+// binary. Operators on Windows should rely on LogFile/lumberjack rotation, or the
+// text/json sink written to stdout, instead of cfg.Default.SyslogAddress.
+func newSyslogWriter(address string) (io.Writer, error) {
+	return nil, fmt.Errorf("syslog is not supported on windows")
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"garm/cache"
+	"garm/runner/common"
+
+	"github.com/google/go-github/v48/github"
+	"github.com/pkg/errors"
+)
+
+// registrationTokenEarlyExpiry is how long before a registration token's documented
+// 1h lifetime we stop serving it from cache, so callers never hand out a token that is
+// about to be rejected by GitHub mid-bootstrap.
+const registrationTokenEarlyExpiry = 30 * time.Second
+
+// ListRunnerApplicationDownloadsCached wraps ghc.ListRunnerApplicationDownloads with a
+// cache.Cache lookup keyed on the entity, so that scaling up many runners for the same
+// repo/org/enterprise in a short span of time doesn't turn into a GitHub API call per
+// runner for what is, in practice, a manifest that changes a few times a year.
+func ListRunnerApplicationDownloadsCached(ctx context.Context, ghc common.GithubClient, owner, repo string) ([]*github.RunnerApplicationDownload, error) {
+	cacheKey := fmt.Sprintf("tools-download:%s/%s", owner, repo)
+
+	c := cache.FromContext(ctx)
+	if cached, ok := c.Get(cacheKey); ok {
+		tools, ok := cached.([]*github.RunnerApplicationDownload)
+		if ok {
+			return tools, nil
+		}
+	}
+
+	tools, _, err := ghc.ListRunnerApplicationDownloads(ctx, owner, repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching runner application downloads")
+	}
+
+	c.Set(cacheKey, tools, cache.DefaultTTL)
+	return tools, nil
+}
+
+// GetCachedRegistrationToken returns the current registration token for
+// owner/repo, fetching a fresh one from GitHub only once the previously cached one is
+// within registrationTokenEarlyExpiry of its documented 1h expiry.
+func GetCachedRegistrationToken(ctx context.Context, ghc common.GithubClient, owner, repo string) (string, error) {
+	cacheKey := fmt.Sprintf("registration-token:%s/%s", owner, repo)
+
+	c := cache.FromContext(ctx)
+	if cached, ok := c.Get(cacheKey); ok {
+		if token, ok := cached.(string); ok {
+			return token, nil
+		}
+	}
+
+	regToken, _, err := ghc.CreateRegistrationToken(ctx, owner, repo)
+	if err != nil {
+		return "", errors.Wrap(err, "creating registration token")
+	}
+	if regToken == nil || regToken.Token == nil {
+		return "", fmt.Errorf("empty registration token returned by github")
+	}
+
+	ttl := time.Hour - registrationTokenEarlyExpiry
+	if regToken.ExpiresAt != nil {
+		ttl = time.Until(regToken.ExpiresAt.Time) - registrationTokenEarlyExpiry
+	}
+	if ttl > 0 {
+		c.Set(cacheKey, *regToken.Token, ttl)
+	}
+
+	return *regToken.Token, nil
+}
@@ -16,8 +16,6 @@ package util
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
@@ -37,6 +35,7 @@ import (
 	runnerErrors "garm/errors"
 	"garm/params"
 	"garm/runner/common"
+	"garm/secrets"
 
 	"github.com/google/go-github/v48/github"
 	"github.com/pkg/errors"
@@ -163,6 +162,11 @@ func OSToOSType(os string) (config.OSType, error) {
 	return osType, nil
 }
 
+// GithubClient returns a github client that can be used to talk to the github API. Depending on
+// the AuthType set on credsDetails, this will either be backed by a static OAuth2 token (the
+// classic PAT flow) or by a GitHub App installation transport, which mints and refreshes its own
+// short lived installation tokens. The token argument is only consulted for the PAT flow; it is
+// ignored when credsDetails.AuthType is params.GithubAuthTypeApp.
 func GithubClient(ctx context.Context, token string, credsDetails params.GithubCredentials) (common.GithubClient, common.GithubEnterpriseClient, error) {
 	var roots *x509.CertPool
 	if credsDetails.CABundle != nil && len(credsDetails.CABundle) > 0 {
@@ -177,13 +181,24 @@ func GithubClient(ctx context.Context, token string, credsDetails params.GithubC
 			ClientCAs: roots,
 		},
 	}
-	httpClient := &http.Client{Transport: httpTransport}
-	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
 
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
+	var tc *http.Client
+	switch credsDetails.AuthType {
+	case params.GithubAuthTypeApp:
+		appTransport, err := newAppInstallationTransport(httpTransport, credsDetails.App, credsDetails.APIBaseURL)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "creating app installation transport")
+		}
+		tc = &http.Client{Transport: appTransport}
+	default:
+		httpClient := &http.Client{Transport: httpTransport}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+
+		ts := oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: token},
+		)
+		tc = oauth2.NewClient(ctx, ts)
+	}
 
 	ghClient, err := github.NewEnterpriseClient(credsDetails.APIBaseURL, credsDetails.UploadBaseURL, tc)
 	if err != nil {
@@ -213,7 +228,6 @@ func GetCloudConfig(bootstrapParams params.BootstrapInstance, tools github.Runne
 		FileName:          *tools.Filename,
 		DownloadURL:       *tools.DownloadURL,
 		TempDownloadToken: tempToken,
-		GithubToken:       bootstrapParams.GithubRunnerAccessToken,
 		RunnerUsername:    config.DefaultUser,
 		RunnerGroup:       config.DefaultUser,
 		RepoURL:           bootstrapParams.RepoURL,
@@ -223,6 +237,18 @@ func GetCloudConfig(bootstrapParams params.BootstrapInstance, tools github.Runne
 		CallbackToken:     bootstrapParams.InstanceToken,
 	}
 
+	switch bootstrapParams.RegistrationMode {
+	case params.RegistrationModeJITConfig:
+		// The runner is configured entirely from the single-use JIT config; unlike the
+		// token flow, run.sh never talks to RepoURL/RunnerLabels/RunnerGroup itself.
+		if bootstrapParams.JitConfig == "" {
+			return "", fmt.Errorf("missing JIT config")
+		}
+		installRunnerParams.JitConfig = bootstrapParams.JitConfig
+	default:
+		installRunnerParams.GithubToken = bootstrapParams.GithubRunnerAccessToken
+	}
+
 	installScript, err := cloudconfig.InstallRunnerScript(installRunnerParams)
 	if err != nil {
 		return "", errors.Wrap(err, "generating script")
@@ -260,55 +286,36 @@ func GetRandomString(n int) (string, error) {
 	return string(data), nil
 }
 
+// Aes256EncodeString seals target using the AES-256-GCM passphrase provider in the
+// secrets package.
+//
+// Deprecated: callers that care about pluggable backends (Vault Transit, KMS, age) or
+// key rotation should build a secrets.Sealer via secrets.NewAESPassphraseSealer (or
+// another provider) and call Seal/Unseal directly. This wrapper exists so existing
+// callers keep working unmodified; Aes256DecodeString transparently reads back both
+// the new envelope format and records sealed by the pre-envelope raw format, so no
+// migration is required to keep using it, though `garm-cli secrets rewrap` can still
+// be used to move everything onto a new provider/key.
 func Aes256EncodeString(target string, passphrase string) ([]byte, error) {
-	if len(passphrase) != 32 {
-		return nil, fmt.Errorf("invalid passphrase length (expected length 32 characters)")
-	}
-
-	toEncrypt := []byte(target)
-	block, err := aes.NewCipher([]byte(passphrase))
-	if err != nil {
-		return nil, errors.Wrap(err, "creating cipher")
-	}
-
-	aesgcm, err := cipher.NewGCM(block)
+	sealer, err := secrets.NewAESPassphraseSealer(secrets.LegacyAESPassphraseKeyID, passphrase)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating new aead")
+		return nil, err
 	}
-
-	nonce := make([]byte, aesgcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, errors.Wrap(err, "creating nonce")
-	}
-
-	ciphertext := aesgcm.Seal(nonce, nonce, toEncrypt, nil)
-	return ciphertext, nil
+	return sealer.Seal([]byte(target))
 }
 
+// Aes256DecodeString unseals target using the AES-256-GCM passphrase provider.
+//
+// Deprecated: see Aes256EncodeString.
 func Aes256DecodeString(target []byte, passphrase string) (string, error) {
-	if len(passphrase) != 32 {
-		return "", fmt.Errorf("invalid passphrase length (expected length 32 characters)")
-	}
-
-	block, err := aes.NewCipher([]byte(passphrase))
+	sealer, err := secrets.NewAESPassphraseSealer(secrets.LegacyAESPassphraseKeyID, passphrase)
 	if err != nil {
-		return "", errors.Wrap(err, "creating cipher")
-	}
-
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", errors.Wrap(err, "creating new aead")
-	}
-
-	nonceSize := aesgcm.NonceSize()
-	if len(target) < nonceSize {
-		return "", fmt.Errorf("failed to decrypt text")
+		return "", err
 	}
 
-	nonce, ciphertext := target[:nonceSize], target[nonceSize:]
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := sealer.Unseal(target)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt text")
+		return "", err
 	}
 	return string(plaintext), nil
 }